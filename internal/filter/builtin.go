@@ -0,0 +1,151 @@
+package filter
+
+import (
+	"regexp"
+
+	mcPkt "github.com/Tnze/go-mc/net/packet"
+
+	"github.com/zischknall/mcreplay/internal/pcap"
+)
+
+// These mirror the handshaking/status/login/play ordering main.go's own
+// state constants use; PacketFilter only ever sees state as a plain int, so
+// the built-in filters hardcode the same numbering here.
+const (
+	loginState = 2
+	playState  = 3
+)
+
+const (
+	loginStartPacketID         int32 = 0x00
+	encryptionResponsePacketID int32 = 0x01
+)
+
+// RedactLogin replaces the client's username in Login Start and scrubs the
+// shared secret / verify token out of Encryption Response, so a saved
+// capture doesn't leak an account's credentials or session key.
+type RedactLogin struct{}
+
+func (RedactLogin) Filter(dir pcap.Direction, state int, pkt *mcPkt.Packet) (bool, *mcPkt.Packet) {
+	if dir != pcap.Serverbound || state != loginState {
+		return true, nil
+	}
+
+	switch pkt.ID {
+	case loginStartPacketID:
+		replacement := mcPkt.Marshal(pkt.ID, mcPkt.String("[redacted]"))
+		return true, &replacement
+	case encryptionResponsePacketID:
+		replacement := mcPkt.Marshal(pkt.ID, mcPkt.VarInt(0), mcPkt.VarInt(0))
+		return true, &replacement
+	}
+
+	return true, nil
+}
+
+// chatPacketID is the clientbound Chat Message packet ID for the protocol
+// version this proxy otherwise targets (see the clientbound IDs already
+// used throughout main.go, e.g. 0x34 for Player Position And Look).
+const chatPacketID int32 = 0x0E
+
+// ChatFilter drops clientbound chat messages whose text matches Pattern,
+// e.g. to keep bot spam or moderation noise out of a recording. Since it
+// only ever sees clientbound packets, it only has an effect on -format pcap
+// recordings: the default -format json recording never captures clientbound
+// traffic at all.
+type ChatFilter struct {
+	Pattern *regexp.Regexp
+}
+
+func (f ChatFilter) Filter(dir pcap.Direction, state int, pkt *mcPkt.Packet) (bool, *mcPkt.Packet) {
+	if dir != pcap.Clientbound || state != playState || pkt.ID != chatPacketID {
+		return true, nil
+	}
+
+	var message mcPkt.String
+	if err := pkt.Scan(&message); err != nil {
+		return true, nil
+	}
+
+	if f.Pattern.MatchString(string(message)) {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+const (
+	playerPositionPacketID        int32 = 0x12
+	playerPositionAndLookPacketID int32 = 0x13
+)
+
+// PositionOffset shifts a replayed player's X/Y/Z by a fixed offset, so a
+// session recorded in one world can be replayed at the matching location in
+// another.
+type PositionOffset struct {
+	X, Y, Z float64
+}
+
+func (f PositionOffset) Filter(dir pcap.Direction, state int, pkt *mcPkt.Packet) (bool, *mcPkt.Packet) {
+	if dir != pcap.Serverbound || state != playState {
+		return true, nil
+	}
+
+	switch pkt.ID {
+	case playerPositionPacketID:
+		var x, y, z mcPkt.Double
+		var onGround mcPkt.Boolean
+		if err := pkt.Scan(&x, &y, &z, &onGround); err != nil {
+			return true, nil
+		}
+		replacement := mcPkt.Marshal(pkt.ID,
+			mcPkt.Double(float64(x)+f.X), mcPkt.Double(float64(y)+f.Y), mcPkt.Double(float64(z)+f.Z),
+			onGround)
+		return true, &replacement
+	case playerPositionAndLookPacketID:
+		var x, y, z mcPkt.Double
+		var yaw, pitch mcPkt.Float
+		var onGround mcPkt.Boolean
+		if err := pkt.Scan(&x, &y, &z, &yaw, &pitch, &onGround); err != nil {
+			return true, nil
+		}
+		replacement := mcPkt.Marshal(pkt.ID,
+			mcPkt.Double(float64(x)+f.X), mcPkt.Double(float64(y)+f.Y), mcPkt.Double(float64(z)+f.Z),
+			yaw, pitch, onGround)
+		return true, &replacement
+	}
+
+	return true, nil
+}
+
+// EntityIDFilter drops clientbound packets that reference entity IDs
+// (spawn/teleport/metadata packets and the like) as they're captured for a
+// pcap recording, e.g. to keep other players' entities out of a capture
+// that's going to be shared. It's a record-time filter: replay only ever
+// sends the client's own serverbound packets back to a backend, so it never
+// sees the clientbound packets this filter looks at. Which packet IDs count
+// as entity-scoped is version-specific, so callers configure the set
+// explicitly.
+type EntityIDFilter struct {
+	PacketIDs map[int32]struct{}
+}
+
+// NewEntityIDFilter builds an EntityIDFilter that drops clientbound packets
+// with any of the given IDs.
+func NewEntityIDFilter(packetIDs ...int32) EntityIDFilter {
+	ids := make(map[int32]struct{}, len(packetIDs))
+	for _, id := range packetIDs {
+		ids[id] = struct{}{}
+	}
+	return EntityIDFilter{PacketIDs: ids}
+}
+
+func (f EntityIDFilter) Filter(dir pcap.Direction, state int, pkt *mcPkt.Packet) (bool, *mcPkt.Packet) {
+	if dir != pcap.Clientbound {
+		return true, nil
+	}
+	if _, ok := f.PacketIDs[pkt.ID]; ok {
+		return false, nil
+	}
+	return true, nil
+}
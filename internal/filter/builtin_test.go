@@ -0,0 +1,129 @@
+package filter
+
+import (
+	"regexp"
+	"testing"
+
+	mcPkt "github.com/Tnze/go-mc/net/packet"
+
+	"github.com/zischknall/mcreplay/internal/pcap"
+)
+
+func TestRedactLogin(t *testing.T) {
+	f := RedactLogin{}
+
+	loginStart := mcPkt.Marshal(loginStartPacketID, mcPkt.String("realAccountName"))
+	keep, replacement := f.Filter(pcap.Serverbound, loginState, &loginStart)
+	if !keep || replacement == nil {
+		t.Fatalf("Filter(Login Start) = (%v, %v), want (true, non-nil)", keep, replacement)
+	}
+	var username mcPkt.String
+	if err := replacement.Scan(&username); err != nil {
+		t.Fatalf("Scan(redacted Login Start) error = %v", err)
+	}
+	if username == "realAccountName" {
+		t.Error("Filter(Login Start) did not redact the username")
+	}
+
+	encryptionResponse := mcPkt.Marshal(encryptionResponsePacketID, mcPkt.VarInt(128), mcPkt.VarInt(128))
+	keep, replacement = f.Filter(pcap.Serverbound, loginState, &encryptionResponse)
+	if !keep || replacement == nil {
+		t.Fatalf("Filter(Encryption Response) = (%v, %v), want (true, non-nil)", keep, replacement)
+	}
+	var sharedSecret, verifyToken mcPkt.VarInt
+	if err := replacement.Scan(&sharedSecret, &verifyToken); err != nil {
+		t.Fatalf("Scan(redacted Encryption Response) error = %v", err)
+	}
+	if sharedSecret != 0 || verifyToken != 0 {
+		t.Errorf("Filter(Encryption Response) = %d, %d, want 0, 0", sharedSecret, verifyToken)
+	}
+
+	// Outside login state, RedactLogin must not touch anything.
+	outsideLoginState := mcPkt.Marshal(loginStartPacketID, mcPkt.String("realAccountName"))
+	keep, replacement = f.Filter(pcap.Serverbound, playState, &outsideLoginState)
+	if !keep || replacement != nil {
+		t.Errorf("Filter() outside login state = (%v, %v), want (true, nil)", keep, replacement)
+	}
+}
+
+func TestChatFilter(t *testing.T) {
+	f := ChatFilter{Pattern: regexp.MustCompile(`^\[Server\]`)}
+
+	spam := mcPkt.Marshal(chatPacketID, mcPkt.String(`[Server] connection lost`))
+	keep, replacement := f.Filter(pcap.Clientbound, playState, &spam)
+	if keep || replacement != nil {
+		t.Errorf("Filter(matching chat) = (%v, %v), want (false, nil)", keep, replacement)
+	}
+
+	normal := mcPkt.Marshal(chatPacketID, mcPkt.String(`<Alice> hello`))
+	keep, replacement = f.Filter(pcap.Clientbound, playState, &normal)
+	if !keep || replacement != nil {
+		t.Errorf("Filter(non-matching chat) = (%v, %v), want (true, nil)", keep, replacement)
+	}
+
+	serverboundChat := mcPkt.Marshal(chatPacketID, mcPkt.String(`[Server] should be ignored`))
+	keep, replacement = f.Filter(pcap.Serverbound, playState, &serverboundChat)
+	if !keep || replacement != nil {
+		t.Errorf("Filter() on serverbound direction = (%v, %v), want (true, nil)", keep, replacement)
+	}
+}
+
+func TestPositionOffset(t *testing.T) {
+	f := PositionOffset{X: 10, Y: 0, Z: -5}
+
+	position := mcPkt.Marshal(playerPositionPacketID, mcPkt.Double(1), mcPkt.Double(2), mcPkt.Double(3), mcPkt.Boolean(true))
+	keep, replacement := f.Filter(pcap.Serverbound, playState, &position)
+	if !keep || replacement == nil {
+		t.Fatalf("Filter(Player Position) = (%v, %v), want (true, non-nil)", keep, replacement)
+	}
+	var x, y, z mcPkt.Double
+	var onGround mcPkt.Boolean
+	if err := replacement.Scan(&x, &y, &z, &onGround); err != nil {
+		t.Fatalf("Scan(offset Player Position) error = %v", err)
+	}
+	if x != 11 || y != 2 || z != -2 || !onGround {
+		t.Errorf("Filter(Player Position) offset x,y,z,onGround = %v,%v,%v,%v, want 11,2,-2,true", x, y, z, onGround)
+	}
+
+	positionAndLook := mcPkt.Marshal(playerPositionAndLookPacketID,
+		mcPkt.Double(1), mcPkt.Double(2), mcPkt.Double(3), mcPkt.Float(90), mcPkt.Float(0), mcPkt.Boolean(false))
+	keep, replacement = f.Filter(pcap.Serverbound, playState, &positionAndLook)
+	if !keep || replacement == nil {
+		t.Fatalf("Filter(Player Position And Rotation) = (%v, %v), want (true, non-nil)", keep, replacement)
+	}
+	var yaw, pitch mcPkt.Float
+	if err := replacement.Scan(&x, &y, &z, &yaw, &pitch, &onGround); err != nil {
+		t.Fatalf("Scan(offset Player Position And Rotation) error = %v", err)
+	}
+	if x != 11 || y != 2 || z != -2 || yaw != 90 || pitch != 0 {
+		t.Errorf("Filter(Player Position And Rotation) offset x,y,z,yaw,pitch = %v,%v,%v,%v,%v, want 11,2,-2,90,0", x, y, z, yaw, pitch)
+	}
+
+	other := mcPkt.Marshal(int32(0x00), mcPkt.VarInt(1))
+	keep, replacement = f.Filter(pcap.Serverbound, playState, &other)
+	if !keep || replacement != nil {
+		t.Errorf("Filter(unrelated packet) = (%v, %v), want (true, nil)", keep, replacement)
+	}
+}
+
+func TestEntityIDFilter(t *testing.T) {
+	f := NewEntityIDFilter(0x03, 0x56)
+
+	spawn := mcPkt.Marshal(int32(0x03), mcPkt.VarInt(42))
+	keep, replacement := f.Filter(pcap.Clientbound, playState, &spawn)
+	if keep || replacement != nil {
+		t.Errorf("Filter(configured ID) = (%v, %v), want (false, nil)", keep, replacement)
+	}
+
+	other := mcPkt.Marshal(int32(0x04), mcPkt.VarInt(42))
+	keep, replacement = f.Filter(pcap.Clientbound, playState, &other)
+	if !keep || replacement != nil {
+		t.Errorf("Filter(unconfigured ID) = (%v, %v), want (true, nil)", keep, replacement)
+	}
+
+	serverboundSpawn := mcPkt.Marshal(int32(0x03), mcPkt.VarInt(42))
+	keep, replacement = f.Filter(pcap.Serverbound, playState, &serverboundSpawn)
+	if !keep || replacement != nil {
+		t.Errorf("Filter() on serverbound direction = (%v, %v), want (true, nil)", keep, replacement)
+	}
+}
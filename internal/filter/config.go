@@ -0,0 +1,82 @@
+package filter
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// chainConfig is the "record_filters"/"replay_filters" sections of the same
+// YAML file internal/proxy reads for routing, so operators configure both in
+// one place. The two sections are kept separate, rather than one shared
+// "filters" list, because a filter meant to sanitize a capture for sharing
+// (e.g. redact_login) must never also run during replay and rewrite a live
+// session's real credentials, and a filter meant to retarget a replay (e.g.
+// position_offset) must never also corrupt a brand-new recording.
+type chainConfig struct {
+	RecordFilters struct {
+		RedactLogin bool `yaml:"redact_login"`
+		// DropChatPattern and StripEntityPacketIDs only have any effect on
+		// -format pcap recordings: clientbound packets, which is all either
+		// filter looks at, are only ever captured into the pcap's TCP
+		// stream, never into the default -format json recording.
+		DropChatPattern      string  `yaml:"drop_chat_pattern"`
+		StripEntityPacketIDs []int32 `yaml:"strip_entity_packet_ids"`
+	} `yaml:"record_filters"`
+	ReplayFilters struct {
+		PositionOffset *struct {
+			X float64 `yaml:"x"`
+			Y float64 `yaml:"y"`
+			Z float64 `yaml:"z"`
+		} `yaml:"position_offset"`
+	} `yaml:"replay_filters"`
+}
+
+// LoadChains reads the record_filters and replay_filters sections of the
+// config file at path, returning the Chain to apply while recording and the
+// (separate) Chain to apply while replaying. A missing path, or a config
+// file with neither section, yields two empty chains so recording/replay
+// behave exactly as before filters were introduced.
+func LoadChains(path string) (record, replay Chain, err error) {
+	if path == "" {
+		return nil, nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read config file: %w", err)
+	}
+
+	var cfg chainConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, nil, fmt.Errorf("unable to parse config file: %w", err)
+	}
+
+	if cfg.RecordFilters.RedactLogin {
+		record = append(record, RedactLogin{})
+	}
+
+	if cfg.RecordFilters.DropChatPattern != "" {
+		pattern, err := regexp.Compile(cfg.RecordFilters.DropChatPattern)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to compile drop_chat_pattern: %w", err)
+		}
+		record = append(record, ChatFilter{Pattern: pattern})
+	}
+
+	if len(cfg.RecordFilters.StripEntityPacketIDs) > 0 {
+		record = append(record, NewEntityIDFilter(cfg.RecordFilters.StripEntityPacketIDs...))
+	}
+
+	if cfg.ReplayFilters.PositionOffset != nil {
+		replay = append(replay, PositionOffset{
+			X: cfg.ReplayFilters.PositionOffset.X,
+			Y: cfg.ReplayFilters.PositionOffset.Y,
+			Z: cfg.ReplayFilters.PositionOffset.Z,
+		})
+	}
+
+	return record, replay, nil
+}
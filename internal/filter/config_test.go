@@ -0,0 +1,56 @@
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadChainsSeparatesRecordAndReplayFilters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	contents := `
+record_filters:
+  redact_login: true
+  strip_entity_packet_ids: [30, 86]
+replay_filters:
+  position_offset:
+    x: 1
+    y: 2
+    z: 3
+`
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("unable to write test config file: %v", err)
+	}
+
+	record, replay, err := LoadChains(path)
+	if err != nil {
+		t.Fatalf("LoadChains() error = %v", err)
+	}
+
+	if len(record) != 2 {
+		t.Fatalf("len(record) = %d, want 2", len(record))
+	}
+	if _, ok := record[0].(RedactLogin); !ok {
+		t.Errorf("record[0] = %T, want RedactLogin", record[0])
+	}
+	if _, ok := record[1].(EntityIDFilter); !ok {
+		t.Errorf("record[1] = %T, want EntityIDFilter", record[1])
+	}
+
+	if len(replay) != 1 {
+		t.Fatalf("len(replay) = %d, want 1", len(replay))
+	}
+	if _, ok := replay[0].(PositionOffset); !ok {
+		t.Errorf("replay[0] = %T, want PositionOffset", replay[0])
+	}
+}
+
+func TestLoadChainsEmptyPath(t *testing.T) {
+	record, replay, err := LoadChains("")
+	if err != nil {
+		t.Fatalf("LoadChains(\"\") error = %v", err)
+	}
+	if record != nil || replay != nil {
+		t.Errorf("LoadChains(\"\") = %v, %v, want nil, nil", record, replay)
+	}
+}
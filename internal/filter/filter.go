@@ -0,0 +1,40 @@
+// Package filter lets a recorded session be sanitized and edited instead of
+// staying a one-shot capture tied to a specific account and world: filters
+// can redact credentials before a capture is saved, drop packets a user
+// doesn't want kept, or rewrite a packet for replay against a different
+// server.
+package filter
+
+import (
+	mcPkt "github.com/Tnze/go-mc/net/packet"
+
+	"github.com/zischknall/mcreplay/internal/pcap"
+)
+
+// PacketFilter inspects a single packet as it's recorded or replayed. State
+// is the protocol state the packet was seen in (handshaking/status/login/play,
+// numbered the same way main.go's state constants are). Returning keep=false
+// drops the packet; a non-nil replacement substitutes it without dropping it.
+type PacketFilter interface {
+	Filter(dir pcap.Direction, state int, pkt *mcPkt.Packet) (keep bool, replacement *mcPkt.Packet)
+}
+
+// Chain runs a sequence of filters over a packet in order, stopping as soon
+// as one of them drops it.
+type Chain []PacketFilter
+
+// Apply runs pkt through the chain, returning the (possibly rewritten)
+// packet and whether it survived.
+func (c Chain) Apply(dir pcap.Direction, state int, pkt mcPkt.Packet) (kept mcPkt.Packet, ok bool) {
+	kept = pkt
+	for _, f := range c {
+		keep, replacement := f.Filter(dir, state, &kept)
+		if !keep {
+			return kept, false
+		}
+		if replacement != nil {
+			kept = *replacement
+		}
+	}
+	return kept, true
+}
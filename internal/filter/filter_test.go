@@ -0,0 +1,60 @@
+package filter
+
+import (
+	"testing"
+
+	mcPkt "github.com/Tnze/go-mc/net/packet"
+
+	"github.com/zischknall/mcreplay/internal/pcap"
+)
+
+type rewriteToID struct {
+	id int32
+}
+
+func (f rewriteToID) Filter(dir pcap.Direction, state int, pkt *mcPkt.Packet) (bool, *mcPkt.Packet) {
+	replacement := mcPkt.Marshal(f.id, mcPkt.VarInt(0))
+	return true, &replacement
+}
+
+type dropAll struct{}
+
+func (dropAll) Filter(dir pcap.Direction, state int, pkt *mcPkt.Packet) (bool, *mcPkt.Packet) {
+	return false, nil
+}
+
+func TestChainApplyChainsReplacements(t *testing.T) {
+	chain := Chain{rewriteToID{id: 0x01}, rewriteToID{id: 0x02}}
+
+	original := mcPkt.Marshal(int32(0x00), mcPkt.VarInt(0))
+	kept, ok := chain.Apply(pcap.Serverbound, playState, original)
+	if !ok {
+		t.Fatal("Apply() ok = false, want true")
+	}
+	if kept.ID != 0x02 {
+		t.Errorf("Apply() packet ID = %#x, want %#x", kept.ID, 0x02)
+	}
+}
+
+func TestChainApplyStopsAtFirstDrop(t *testing.T) {
+	chain := Chain{dropAll{}, rewriteToID{id: 0x02}}
+
+	original := mcPkt.Marshal(int32(0x00), mcPkt.VarInt(0))
+	_, ok := chain.Apply(pcap.Serverbound, playState, original)
+	if ok {
+		t.Fatal("Apply() ok = true, want false")
+	}
+}
+
+func TestChainApplyEmptyChainKeepsPacket(t *testing.T) {
+	var chain Chain
+
+	original := mcPkt.Marshal(int32(0x00), mcPkt.VarInt(0))
+	kept, ok := chain.Apply(pcap.Serverbound, playState, original)
+	if !ok {
+		t.Fatal("Apply() ok = false, want true")
+	}
+	if kept.ID != original.ID {
+		t.Errorf("Apply() packet ID = %#x, want %#x", kept.ID, original.ID)
+	}
+}
@@ -0,0 +1,164 @@
+// Package pcap turns a recorded Minecraft session into a libpcap capture so
+// it can be opened in Wireshark and dissected with the existing Minecraft
+// protocol dissector.
+//
+// Since a recorded session only has packets and relative timestamps, not an
+// actual network capture, the writer synthesizes an Ethernet/IPv4/TCP stream
+// between two virtual hosts (10.0.0.1 as the client, 10.0.0.2 as the server)
+// so that directionality is preserved and Wireshark's TCP reassembly works.
+package pcap
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	mcPkt "github.com/Tnze/go-mc/net/packet"
+)
+
+// Direction identifies which side of the proxied connection a packet
+// travelled across.
+type Direction int
+
+const (
+	Serverbound Direction = iota
+	Clientbound
+)
+
+var (
+	clientMAC = net.HardwareAddr{0x02, 0x4d, 0x43, 0x00, 0x00, 0x01}
+	serverMAC = net.HardwareAddr{0x02, 0x4d, 0x43, 0x00, 0x00, 0x02}
+	clientIP  = net.IPv4(10, 0, 0, 1).To4()
+	serverIP  = net.IPv4(10, 0, 0, 2).To4()
+)
+
+const (
+	serverTCPPort layers.TCPPort = 25565
+	clientTCPPort layers.TCPPort = 49152
+
+	initialClientSeq uint32 = 1000
+	initialServerSeq uint32 = 2000
+)
+
+type tcpFlags struct {
+	syn, ack, fin bool
+}
+
+// Writer appends a recorded session to a libpcap capture as a synthetic TCP
+// stream between a virtual client and server host.
+type Writer struct {
+	pw        *pcapgo.Writer
+	startTime time.Time
+	clientSeq uint32
+	serverSeq uint32
+}
+
+// NewWriter writes the pcap file header to out and opens the connection with
+// a TCP handshake (SYN, SYN-ACK, ACK) timestamped at startTime.
+func NewWriter(out io.Writer, startTime time.Time) (*Writer, error) {
+	pw := pcapgo.NewWriter(out)
+	if err := pw.WriteFileHeader(65536, layers.LinkTypeEthernet); err != nil {
+		return nil, fmt.Errorf("unable to write pcap file header: %w", err)
+	}
+
+	w := &Writer{pw: pw, startTime: startTime, clientSeq: initialClientSeq, serverSeq: initialServerSeq}
+
+	if err := w.writeSegment(startTime, Serverbound, tcpFlags{syn: true}, nil); err != nil {
+		return nil, fmt.Errorf("unable to write SYN: %w", err)
+	}
+	w.clientSeq++
+
+	if err := w.writeSegment(startTime, Clientbound, tcpFlags{syn: true, ack: true}, nil); err != nil {
+		return nil, fmt.Errorf("unable to write SYN-ACK: %w", err)
+	}
+	w.serverSeq++
+
+	if err := w.writeSegment(startTime, Serverbound, tcpFlags{ack: true}, nil); err != nil {
+		return nil, fmt.Errorf("unable to write ACK: %w", err)
+	}
+
+	return w, nil
+}
+
+// WritePacket encodes pkt the same way the client/server itself would put it
+// on the wire (via Packet.Pack, uncompressed) and appends it as a TCP segment
+// travelling in dir, timestamped at StartTime+relTime. Packing it the same
+// way go-mc does, rather than a bespoke encoder, is what lets Wireshark's
+// Minecraft dissector recognize the stream.
+func (w *Writer) WritePacket(dir Direction, pkt mcPkt.Packet, relTime time.Duration) error {
+	payload := pkt.Pack(0)
+
+	if err := w.writeSegment(w.startTime.Add(relTime), dir, tcpFlags{ack: true}, payload); err != nil {
+		return fmt.Errorf("unable to write packet %#x: %w", pkt.ID, err)
+	}
+
+	if dir == Serverbound {
+		w.clientSeq += uint32(len(payload))
+	} else {
+		w.serverSeq += uint32(len(payload))
+	}
+
+	return nil
+}
+
+// Close writes the closing FIN/ACK exchange timestamped at endTime.
+func (w *Writer) Close(endTime time.Time) error {
+	if err := w.writeSegment(endTime, Serverbound, tcpFlags{fin: true, ack: true}, nil); err != nil {
+		return fmt.Errorf("unable to write FIN: %w", err)
+	}
+	w.clientSeq++
+
+	if err := w.writeSegment(endTime, Clientbound, tcpFlags{fin: true, ack: true}, nil); err != nil {
+		return fmt.Errorf("unable to write FIN-ACK: %w", err)
+	}
+	w.serverSeq++
+
+	return nil
+}
+
+func (w *Writer) writeSegment(ts time.Time, dir Direction, flags tcpFlags, payload []byte) error {
+	srcMAC, dstMAC := clientMAC, serverMAC
+	srcIP, dstIP := clientIP, serverIP
+	srcPort, dstPort := clientTCPPort, serverTCPPort
+	seq, ack := w.clientSeq, w.serverSeq
+
+	if dir == Clientbound {
+		srcMAC, dstMAC = serverMAC, clientMAC
+		srcIP, dstIP = serverIP, clientIP
+		srcPort, dstPort = serverTCPPort, clientTCPPort
+		seq, ack = w.serverSeq, w.clientSeq
+	}
+
+	eth := &layers.Ethernet{SrcMAC: srcMAC, DstMAC: dstMAC, EthernetType: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: srcIP, DstIP: dstIP}
+	tcp := &layers.TCP{
+		SrcPort: srcPort,
+		DstPort: dstPort,
+		Seq:     seq,
+		Ack:     ack,
+		Window:  65535,
+		SYN:     flags.syn,
+		ACK:     flags.ack,
+		FIN:     flags.fin,
+	}
+	if err := tcp.SetNetworkLayerForChecksum(ip); err != nil {
+		return err
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, tcp, gopacket.Payload(payload)); err != nil {
+		return err
+	}
+
+	return w.pw.WritePacket(gopacket.CaptureInfo{
+		Timestamp:     ts,
+		CaptureLength: len(buf.Bytes()),
+		Length:        len(buf.Bytes()),
+	}, buf.Bytes())
+}
@@ -0,0 +1,79 @@
+package pcap
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	mcPkt "github.com/Tnze/go-mc/net/packet"
+)
+
+func TestWriterRoundTrip(t *testing.T) {
+	startTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, startTime)
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+
+	handshake := mcPkt.Marshal(0x00, mcPkt.VarInt(47), mcPkt.String("localhost"), mcPkt.UnsignedShort(25565), mcPkt.VarInt(2))
+	if err := w.WritePacket(Serverbound, handshake, 10*time.Millisecond); err != nil {
+		t.Fatalf("WritePacket(Serverbound) error = %v", err)
+	}
+
+	disconnect := mcPkt.Marshal(0x00, mcPkt.String(`{"text":"bye"}`))
+	if err := w.WritePacket(Clientbound, disconnect, 20*time.Millisecond); err != nil {
+		t.Fatalf("WritePacket(Clientbound) error = %v", err)
+	}
+
+	if err := w.Close(startTime.Add(30 * time.Millisecond)); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	reader, err := pcapgo.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("pcapgo.NewReader() error = %v", err)
+	}
+
+	var packets [][]byte
+	for {
+		data, _, err := reader.ReadPacketData()
+		if err != nil {
+			break
+		}
+		packets = append(packets, data)
+	}
+
+	// SYN, SYN-ACK, ACK, handshake, disconnect, FIN, FIN-ACK.
+	wantPackets := 7
+	if len(packets) != wantPackets {
+		t.Fatalf("got %d packets, want %d", len(packets), wantPackets)
+	}
+
+	handshakeFrame := gopacket.NewPacket(packets[3], layers.LayerTypeEthernet, gopacket.Default)
+	tcpLayer := handshakeFrame.Layer(layers.LayerTypeTCP)
+	if tcpLayer == nil {
+		t.Fatalf("handshake frame has no TCP layer")
+	}
+	tcp := tcpLayer.(*layers.TCP)
+	if tcp.SrcPort != clientTCPPort || tcp.DstPort != serverTCPPort {
+		t.Errorf("serverbound frame has ports %d->%d, want %d->%d", tcp.SrcPort, tcp.DstPort, clientTCPPort, serverTCPPort)
+	}
+
+	gotPayload := tcp.Payload
+	wantPayload := handshake.Pack(0)
+	if !bytes.Equal(gotPayload, wantPayload) {
+		t.Errorf("handshake payload = %x, want %x", gotPayload, wantPayload)
+	}
+
+	disconnectFrame := gopacket.NewPacket(packets[4], layers.LayerTypeEthernet, gopacket.Default)
+	tcp = disconnectFrame.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if tcp.SrcPort != serverTCPPort || tcp.DstPort != clientTCPPort {
+		t.Errorf("clientbound frame has ports %d->%d, want %d->%d", tcp.SrcPort, tcp.DstPort, serverTCPPort, clientTCPPort)
+	}
+}
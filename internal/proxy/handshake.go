@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"fmt"
+
+	mcPkt "github.com/Tnze/go-mc/net/packet"
+)
+
+// NextState mirrors the "Next State" field of the Minecraft Handshake
+// packet: 1 requests the status ping, 2 requests login.
+type NextState int32
+
+const (
+	NextStateStatus NextState = 1
+	NextStateLogin  NextState = 2
+)
+
+// Handshake is the decoded form of packet 0x00 in the handshaking state,
+// the first packet any Minecraft client sends.
+type Handshake struct {
+	ProtocolVersion int32
+	ServerAddress   string
+	ServerPort      uint16
+	NextState       NextState
+}
+
+// ParseHandshake decodes the Handshake packet a client sent so a Router can
+// decide which backend it should talk to.
+func ParseHandshake(pkt mcPkt.Packet) (Handshake, error) {
+	var (
+		protocolVersion mcPkt.VarInt
+		serverAddress   mcPkt.String
+		serverPort      mcPkt.UnsignedShort
+		nextState       mcPkt.VarInt
+	)
+
+	if pkt.ID != 0x00 {
+		return Handshake{}, fmt.Errorf("packet %#x is not a handshake packet", pkt.ID)
+	}
+
+	if err := pkt.Scan(&protocolVersion, &serverAddress, &serverPort, &nextState); err != nil {
+		return Handshake{}, fmt.Errorf("unable to scan handshake packet: %w", err)
+	}
+
+	return Handshake{
+		ProtocolVersion: int32(protocolVersion),
+		ServerAddress:   string(serverAddress),
+		ServerPort:      uint16(serverPort),
+		NextState:       NextState(nextState),
+	}, nil
+}
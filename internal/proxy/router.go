@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Router decides which backend address a client's handshake should be
+// proxied to. Implementations can be as simple as a single fixed backend or
+// as involved as a database lookup; Config is the built-in, config-file
+// driven implementation.
+type Router interface {
+	Route(handshake Handshake) (backend string, err error)
+}
+
+// Route maps a hostname pattern to a backend address. Pattern may be an
+// exact hostname ("survival.example.com") or a wildcard with a single
+// leading "*." label ("*.example.com").
+type Route struct {
+	Pattern string `yaml:"pattern"`
+	Backend string `yaml:"backend"`
+}
+
+// Config is a Router loaded from a YAML file: it picks a backend based on
+// the hostname the client requested in its handshake, falling back to
+// DefaultBackend when nothing matches. This lets one recorder front many
+// Minecraft servers on the same listen port, SRV/virtual-host style, and
+// record each to its own file.
+type Config struct {
+	DefaultBackend string  `yaml:"default_backend"`
+	Routes         []Route `yaml:"routes"`
+}
+
+// LoadConfig reads and parses a routing config file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file: %w", err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse config file: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// Route implements Router by matching the client's requested hostname
+// against the configured patterns, in order, falling back to
+// DefaultBackend.
+func (c *Config) Route(handshake Handshake) (string, error) {
+	host := normalizeHost(handshake.ServerAddress)
+
+	for _, route := range c.Routes {
+		if matchesPattern(route.Pattern, host) {
+			return route.Backend, nil
+		}
+	}
+
+	if c.DefaultBackend != "" {
+		return c.DefaultBackend, nil
+	}
+
+	return "", fmt.Errorf("no route matches host %q and no default_backend is configured", host)
+}
+
+// normalizeHost strips the legacy Forge/FML handshake suffix (a "\x00"
+// separated marker some modded clients append to the server address) and
+// lower-cases the remainder for case-insensitive matching.
+func normalizeHost(serverAddress string) string {
+	if idx := strings.IndexByte(serverAddress, 0); idx != -1 {
+		serverAddress = serverAddress[:idx]
+	}
+	return strings.ToLower(serverAddress)
+}
+
+func matchesPattern(pattern, host string) bool {
+	pattern = strings.ToLower(pattern)
+
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return host == suffix || strings.HasSuffix(host, "."+suffix)
+	}
+
+	return pattern == host
+}
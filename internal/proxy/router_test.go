@@ -0,0 +1,49 @@
+package proxy
+
+import "testing"
+
+func TestConfigRoute(t *testing.T) {
+	cfg := &Config{
+		DefaultBackend: "default.example.com:25565",
+		Routes: []Route{
+			{Pattern: "survival.example.com", Backend: "survival:25565"},
+			{Pattern: "*.creative.example.com", Backend: "creative:25565"},
+		},
+	}
+
+	cases := []struct {
+		name            string
+		serverAddress   string
+		wantBackend     string
+		wantErrContains string
+	}{
+		{name: "exact match", serverAddress: "survival.example.com", wantBackend: "survival:25565"},
+		{name: "exact match is case-insensitive", serverAddress: "SURVIVAL.example.com", wantBackend: "survival:25565"},
+		{name: "wildcard matches subdomain", serverAddress: "plots.creative.example.com", wantBackend: "creative:25565"},
+		{name: "wildcard matches bare suffix", serverAddress: "creative.example.com", wantBackend: "creative:25565"},
+		{name: "forge handshake suffix is stripped", serverAddress: "survival.example.com\x00FML2\x00", wantBackend: "survival:25565"},
+		{name: "falls back to default", serverAddress: "unknown.example.com", wantBackend: "default.example.com:25565"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			backend, err := cfg.Route(Handshake{ServerAddress: tc.serverAddress})
+			if err != nil {
+				t.Fatalf("Route(%q) error = %v", tc.serverAddress, err)
+			}
+			if backend != tc.wantBackend {
+				t.Errorf("Route(%q) = %q, want %q", tc.serverAddress, backend, tc.wantBackend)
+			}
+		})
+	}
+}
+
+func TestConfigRouteNoMatchNoDefault(t *testing.T) {
+	cfg := &Config{
+		Routes: []Route{{Pattern: "survival.example.com", Backend: "survival:25565"}},
+	}
+
+	if _, err := cfg.Route(Handshake{ServerAddress: "unknown.example.com"}); err == nil {
+		t.Fatal("Route() error = nil, want error for unmatched host with no default_backend")
+	}
+}
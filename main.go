@@ -7,18 +7,28 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
+	"math/rand"
 	"os"
 	"os/signal"
 	"path"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/sirupsen/logrus"
+
 	mcNet "github.com/Tnze/go-mc/net"
 	mcPkt "github.com/Tnze/go-mc/net/packet"
+
+	"github.com/zischknall/mcreplay/internal/filter"
+	"github.com/zischknall/mcreplay/internal/pcap"
+	"github.com/zischknall/mcreplay/internal/proxy"
 )
 
+var logger = logrus.New()
+
 const (
 	handshaking = iota
 	status
@@ -30,17 +40,121 @@ var goalAddress = flag.String("backend", "192.168.88.128:25565", "Address of the
 var listenAddress = flag.String("listen", ":25565", "Address to listen on for client connections")
 var file = flag.String("file", "packets.json", "Path to json file for replaying and saving")
 var doReplay = flag.Bool("replay", false, "bool to activate replaying of given file")
+var outputFormat = flag.String("format", "json", "Format to save recorded sessions in: json or pcap")
+var doConvert = flag.Bool("convert", false, "bool to convert an existing json recording (-file) into a pcap capture")
+var outFile = flag.String("out", "", "Output path for -convert, defaults to -file with its extension replaced by .pcap")
+var logLevel = flag.String("log-level", "info", "Log level: debug, info, warn, or error")
+var logFormat = flag.String("log-format", "text", "Log format: text or json")
+var configFile = flag.String("config", "", "Path to a YAML config file for multi-backend routing, overrides -backend when recording")
+var replaySpeed = flag.Float64("speed", 1, "Replay speed multiplier, e.g. 0.5 for half speed or 2 for double speed")
+var replayLoop = flag.Int("loop", 1, "Number of times to repeat the packet stream during replay")
+var replayStartAt = flag.Duration("start-at", 0, "Skip to this offset into the recording before replaying")
+var replayStopAt = flag.Duration("stop-at", 0, "Stop replaying at this offset into the recording, 0 disables")
+var replayJitter = flag.Duration("jitter", 0, "Maximum random delay added to each replayed packet")
 
 func main() {
 	flag.Parse()
+	configureLogger()
 
-	if *doReplay {
+	switch {
+	case *doConvert:
+		convert(*file, *outFile)
+	case *doReplay:
 		replay()
-	} else {
+	default:
 		record()
 	}
 }
 
+func configureLogger() {
+	level, err := logrus.ParseLevel(*logLevel)
+	if err != nil {
+		logger.WithField("log_level", *logLevel).Warn("Unknown log level, defaulting to info")
+		level = logrus.InfoLevel
+	}
+	logger.SetLevel(level)
+
+	if *logFormat == "json" {
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		logger.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	}
+}
+
+// singleBackendRouter is the proxy.Router used when -config isn't set: it
+// always routes to the backend given via -backend, preserving the
+// single-server behavior this tool had before routing was configurable.
+type singleBackendRouter struct {
+	backend string
+}
+
+func (r singleBackendRouter) Route(_ proxy.Handshake) (string, error) {
+	return r.backend, nil
+}
+
+func loadRouter() (proxy.Router, error) {
+	if *configFile == "" {
+		return singleBackendRouter{backend: *goalAddress}, nil
+	}
+
+	return proxy.LoadConfig(*configFile)
+}
+
+// stateName renders a protocol state constant the way we want it to show up
+// in log fields.
+func stateName(state int) string {
+	switch state {
+	case handshaking:
+		return "handshaking"
+	case status:
+		return "status"
+	case login:
+		return "login"
+	case play:
+		return "play"
+	default:
+		return "unknown"
+	}
+}
+
+// directionName renders a pcap.Direction the way we want it to show up in
+// log fields.
+func directionName(dir pcap.Direction) string {
+	if dir == pcap.Clientbound {
+		return "clientbound"
+	}
+	return "serverbound"
+}
+
+func packetIDHex(id int32) string {
+	return fmt.Sprintf("0x%02x", id)
+}
+
+// convert reads an existing json recording from jsonPath and writes it out
+// as a pcap capture at pcapPath, so older recordings can still be opened in
+// Wireshark without having to re-record them.
+func convert(jsonPath, pcapPath string) {
+	if pcapPath == "" {
+		pcapPath = strings.TrimSuffix(jsonPath, path.Ext(jsonPath)) + ".pcap"
+	}
+
+	data, err := ioutil.ReadFile(jsonPath)
+	if err != nil {
+		logger.WithError(err).WithField("file", jsonPath).Fatal("Unable to read recorded packets file")
+	}
+
+	var sess SerializableSession
+	if err := json.Unmarshal(data, &sess); err != nil {
+		logger.WithError(err).WithField("file", jsonPath).Fatal("Unable to unmarshal recorded packets from file")
+	}
+
+	if err := writePCAP(sess.Packets, time.Now().UTC(), pcapPath); err != nil {
+		logger.WithError(err).WithField("file", jsonPath).Fatal("Unable to convert recording to pcap")
+	}
+
+	logger.WithFields(logrus.Fields{"in": jsonPath, "out": pcapPath}).Info("Converted recording to pcap")
+}
+
 type SerializableSession struct {
 	Packets []recordedPacket
 	LoginX  mcPkt.Double
@@ -49,51 +163,140 @@ type SerializableSession struct {
 }
 
 type Session struct {
-	StartTime time.Time
-	Client    *mcNet.Conn
-	Server    *mcNet.Conn
-	State     int
+	ID          string
+	RemoteAddr  string
+	StartTime   time.Time
+	Client      *mcNet.Conn
+	Server      *mcNet.Conn
+	State       int
+	Filters     filter.Chain
+	CapturePCAP bool
+	// PCAPPackets holds the bidirectional packet stream for -format pcap. It
+	// is kept separate from SerializableSession.Packets (which only ever
+	// holds serverbound packets, the client's own actions, and is what gets
+	// marshaled to packets.json) so picking -format pcap doesn't change what
+	// a JSON recording captures or balloon it with the clientbound firehose
+	// (chunk data, entity updates, inventory, ...) nobody asked to keep.
+	PCAPPackets []recordedPacket
 	SerializableSession
 }
 
-func NewSession(listener *mcNet.Listener) (sess Session, err error) {
+var sessionCounter int64
+
+func nextSessionID() string {
+	return strconv.FormatInt(atomic.AddInt64(&sessionCounter, 1), 10)
+}
+
+func (s *Session) logFields() logrus.Fields {
+	return logrus.Fields{
+		"session_id":  s.ID,
+		"remote_addr": s.RemoteAddr,
+		"state":       stateName(s.State),
+	}
+}
+
+func NewSession(listener *mcNet.Listener, router proxy.Router, filters filter.Chain, capturePCAP bool) (sess Session, err error) {
 	client, err := listener.Accept()
 	if err != nil {
 		return sess, err
 	}
-	log.Printf("Accepted connection from %s\n", client.Socket.RemoteAddr().String())
+	sess.ID = nextSessionID()
+	sess.RemoteAddr = client.Socket.RemoteAddr().String()
 	sess.Client = &client
+	sess.CapturePCAP = capturePCAP
 	sess.StartTime = time.Now().UTC()
+	sess.Filters = filters
+	logger.WithFields(sess.logFields()).Info("Accepted connection")
+
+	handshakePacket, err := client.ReadPacket()
+	if err != nil {
+		_ = client.Close()
+		return sess, fmt.Errorf("unable to read handshake packet: %w", err)
+	}
+
+	handshake, err := proxy.ParseHandshake(handshakePacket)
+	if err != nil {
+		_ = client.Close()
+		return sess, fmt.Errorf("unable to parse handshake packet: %w", err)
+	}
+
+	backend, err := router.Route(handshake)
+	if err != nil {
+		_ = client.Close()
+		return sess, fmt.Errorf("unable to route connection: %w", err)
+	}
 
-	server, err := mcNet.DialMC(*goalAddress)
+	backendConn, err := mcNet.DialMC(backend)
 	if err != nil {
 		_ = client.Close()
 		return sess, err
 	}
-	log.Printf("Connected to backend on %s\n", *goalAddress)
-	sess.Server = server
+	sess.Server = backendConn
+	logger.WithFields(sess.logFields()).WithFields(logrus.Fields{
+		"backend":        backend,
+		"server_address": handshake.ServerAddress,
+	}).Info("Connected to backend")
+
+	sess.proccessServerbound(handshakePacket)
+	if err := sess.Server.WritePacket(handshakePacket); err != nil {
+		sess.Close()
+		return sess, err
+	}
 
-	return sess, err
+	return sess, nil
 }
 
 func (s *Session) SaveToFile(filename string) {
 	jsonPackets, err := json.Marshal(s.SerializableSession)
 	if err != nil {
-		log.Printf("Unable to marshal recorded packets to json: %v\n", err)
+		logger.WithError(err).WithFields(s.logFields()).Error("Unable to marshal recorded packets to json")
 		return
 	}
 
 	resultFile, err := os.Create(filename)
 	if err != nil {
-		log.Printf("Unable to create file for recorded packets: %v\n", err)
+		logger.WithError(err).WithFields(s.logFields()).Error("Unable to create file for recorded packets")
 		return
 	}
 	defer resultFile.Close()
 
 	_, err = resultFile.Write(jsonPackets)
 	if err != nil {
-		log.Printf("Unable to write recorded packets to file: %v\n", err)
+		logger.WithError(err).WithFields(s.logFields()).Error("Unable to write recorded packets to file")
+	}
+}
+
+func (s *Session) SaveToPCAP(filename string) {
+	if err := writePCAP(s.PCAPPackets, s.StartTime, filename); err != nil {
+		logger.WithError(err).WithFields(s.logFields()).Error("Unable to save recorded packets to pcap")
+	}
+}
+
+// writePCAP renders packets as a pcap capture at filename, timestamping them
+// relative to startTime.
+func writePCAP(packets []recordedPacket, startTime time.Time, filename string) error {
+	resultFile, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("unable to create file for pcap capture: %w", err)
+	}
+	defer resultFile.Close()
+
+	w, err := pcap.NewWriter(resultFile, startTime)
+	if err != nil {
+		return fmt.Errorf("unable to create pcap writer: %w", err)
+	}
+
+	var lastRelatTime time.Duration
+	for _, p := range packets {
+		if err := w.WritePacket(p.Direction, p.Packet, p.RelatTime); err != nil {
+			return err
+		}
+		if p.RelatTime > lastRelatTime {
+			lastRelatTime = p.RelatTime
+		}
 	}
+
+	return w.Close(startTime.Add(lastRelatTime))
 }
 
 func (s *Session) Close() {
@@ -125,7 +328,7 @@ func (s *Session) ClientToServer(errs chan error, closer chan interface{}) {
 					errs <- err
 					break
 				}
-				log.Printf("Unable to read packet from client: %v\n", err)
+				logger.WithError(err).WithFields(s.logFields()).Error("Unable to read packet from client")
 				continue
 			}
 
@@ -136,7 +339,7 @@ func (s *Session) ClientToServer(errs chan error, closer chan interface{}) {
 					errs <- err
 					break
 				}
-				log.Printf("Unable to send packet to server: %v\n", err)
+				logger.WithError(err).WithFields(s.logFields()).Error("Unable to send packet to server")
 			}
 		}
 	}
@@ -152,21 +355,41 @@ func (s *Session) proccessServerbound(packet mcPkt.Packet) {
 		}
 	}
 
+	seenIn := s.State
 	s.setStateFromServerbound(packet.ID)
 
+	filtered, keep := s.Filters.Apply(pcap.Serverbound, seenIn, packet)
+	if !keep {
+		logger.WithFields(s.logFields()).WithFields(logrus.Fields{
+			"direction": directionName(pcap.Serverbound),
+			"packet_id": packetIDHex(packet.ID),
+		}).Debug("Dropped packet by filter")
+		return
+	}
+
+	logger.WithFields(s.logFields()).WithFields(logrus.Fields{
+		"direction": directionName(pcap.Serverbound),
+		"packet_id": packetIDHex(filtered.ID),
+	}).Debug("Recording packet")
+
 	recorded := recordedPacket{
-		Packet:    packet,
+		Packet:    filtered,
 		RelatTime: time.Since(s.StartTime),
+		Direction: pcap.Serverbound,
+		State:     s.State,
 	}
 
 	s.Packets = append(s.Packets, recorded)
+	if s.CapturePCAP {
+		s.PCAPPackets = append(s.PCAPPackets, recorded)
+	}
 }
 
 func (s *Session) setStateFromServerbound(id int32) {
 	if s.State == handshaking {
 		if id == 0x00 {
 			s.State = login
-			log.Printf("Switched to login state\n")
+			logger.WithFields(s.logFields()).Info("Switched to login state")
 		}
 	}
 }
@@ -183,7 +406,7 @@ func (s *Session) ServerToClient(errs chan error, closer chan interface{}) {
 					errs <- err
 					break
 				}
-				log.Printf("Unable to read packet from server: %v\n", err)
+				logger.WithError(err).WithFields(s.logFields()).Error("Unable to read packet from server")
 				continue
 			}
 
@@ -194,7 +417,7 @@ func (s *Session) ServerToClient(errs chan error, closer chan interface{}) {
 					errs <- err
 					break
 				}
-				log.Printf("Unable to send packet to client: %v\n", err)
+				logger.WithError(err).WithFields(s.logFields()).Error("Unable to send packet to client")
 			}
 		}
 	}
@@ -206,18 +429,49 @@ func (s *Session) proccessClientbound(packet mcPkt.Packet) {
 	if s.State == play {
 		if packet.ID == 0x34 && s.LoginX == 0 && s.LoginY == 0 && s.LoginZ == 0 {
 			if err := packet.Scan(&s.LoginX, &s.LoginY, &s.LoginZ); err != nil {
-				log.Printf("Unable to parse login position from packet: %v\n", err)
+				logger.WithError(err).WithFields(s.logFields()).Error("Unable to parse login position from packet")
 				return
 			}
 		}
 	}
+
+	// Clientbound traffic (chunk data, entity updates, inventory, ...) is
+	// only ever needed for the pcap capture's bidirectional TCP stream, not
+	// for the JSON recording, so skip the filter chain and PCAPPackets
+	// entirely unless a pcap capture was actually requested.
+	if !s.CapturePCAP {
+		return
+	}
+
+	filtered, keep := s.Filters.Apply(pcap.Clientbound, s.State, packet)
+	if !keep {
+		logger.WithFields(s.logFields()).WithFields(logrus.Fields{
+			"direction": directionName(pcap.Clientbound),
+			"packet_id": packetIDHex(packet.ID),
+		}).Debug("Dropped packet by filter")
+		return
+	}
+
+	logger.WithFields(s.logFields()).WithFields(logrus.Fields{
+		"direction": directionName(pcap.Clientbound),
+		"packet_id": packetIDHex(filtered.ID),
+	}).Debug("Recording packet")
+
+	recorded := recordedPacket{
+		Packet:    filtered,
+		RelatTime: time.Since(s.StartTime),
+		Direction: pcap.Clientbound,
+		State:     s.State,
+	}
+
+	s.PCAPPackets = append(s.PCAPPackets, recorded)
 }
 
 func (s *Session) setStateFromClientbound(id int32) {
 	if s.State == login {
 		if id == 0x02 {
 			s.State = play
-			log.Printf("Switched to play state\n")
+			logger.WithFields(s.logFields()).Info("Switched to play state")
 		}
 	}
 }
@@ -225,66 +479,96 @@ func (s *Session) setStateFromClientbound(id int32) {
 type recordedPacket struct {
 	Packet    mcPkt.Packet
 	RelatTime time.Duration
+	Direction pcap.Direction
+	// State is the protocol state the session was in when the packet was
+	// recorded (after any serverbound state transition it caused), so
+	// replay can tell the Handshake/Login prefix apart from the play-state
+	// packets that follow it.
+	State int
 }
 
-type proxy struct {
-	Listener *mcNet.Listener
-	Sessions []*Session
+// server accepts client connections on a single listen address and proxies
+// each to whatever backend its Router picks.
+type server struct {
+	Listener    *mcNet.Listener
+	Router      proxy.Router
+	Filters     filter.Chain
+	CapturePCAP bool
+	Sessions    []*Session
 }
 
-func newProxy(address string) (p proxy, err error) {
+func newServer(address string, router proxy.Router, filters filter.Chain, capturePCAP bool) (srv server, err error) {
 	listener, err := mcNet.ListenMC(address)
-	p.Listener = listener
+	srv.Listener = listener
+	srv.Router = router
+	srv.Filters = filters
+	srv.CapturePCAP = capturePCAP
 
-	return p, err
+	return srv, err
 }
 
-func (p *proxy) handleSessions() {
+func (srv *server) handleSessions() {
 	for {
-		session, err := NewSession(p.Listener)
+		session, err := NewSession(srv.Listener, srv.Router, srv.Filters, srv.CapturePCAP)
 		if err != nil {
-			log.Printf("Unable to create new session: %v\n", err)
+			logger.WithError(err).Error("Unable to create new session")
 			continue
 		}
-		p.Sessions = append(p.Sessions, &session)
+		srv.Sessions = append(srv.Sessions, &session)
 		go session.StreamBidirectional()
 	}
 }
 
-func (p *proxy) Close() {
-	for _, sess := range p.Sessions {
+func (srv *server) Close() {
+	for _, sess := range srv.Sessions {
 		sess.Close()
 	}
 }
 
-func (p *proxy) SaveSessions() {
-	for i, sess := range p.Sessions {
+func (srv *server) SaveSessions() {
+	for i, sess := range srv.Sessions {
 		prefix := strconv.Itoa(i)
 		dir, filename := path.Split(*file)
 		newName := prefix + filename
 		newPath := dir + newName
+
+		if *outputFormat == "pcap" {
+			newPath = strings.TrimSuffix(newPath, path.Ext(newPath)) + ".pcap"
+			sess.SaveToPCAP(newPath)
+			continue
+		}
+
 		sess.SaveToFile(newPath)
 	}
 }
 
 func record() {
-	p, err := newProxy(*listenAddress)
+	router, err := loadRouter()
+	if err != nil {
+		logger.WithError(err).Fatal("Unable to load router configuration")
+	}
+
+	filters, _, err := filter.LoadChains(*configFile)
+	if err != nil {
+		logger.WithError(err).Fatal("Unable to load filter configuration")
+	}
+
+	srv, err := newServer(*listenAddress, router, filters, *outputFormat == "pcap")
 	if err != nil {
-		log.Fatalf("Unable to create new proxy: %v\n", err)
+		logger.WithError(err).Fatal("Unable to create new server")
 	}
 
-	go p.handleSessions()
+	go srv.handleSessions()
 
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
 	<-signals
-	p.Close()
-	p.SaveSessions()
+	srv.Close()
+	srv.SaveSessions()
 }
 
 func replay() {
 	session := NewReplaySession()
-	go session.respondToServer()
 	session.replayPackets()
 }
 
@@ -294,14 +578,15 @@ type ReplaySession struct {
 }
 
 func NewReplaySession() (sess ReplaySession) {
+	sess.ID = "replay"
+	sess.RemoteAddr = *file
 	sess.ReadPacketsFromFile(*file)
 
-	server, err := mcNet.DialMC(*goalAddress)
+	_, filters, err := filter.LoadChains(*configFile)
 	if err != nil {
-		log.Fatalf("Unable to connect to server: %v\n", err)
+		logger.WithError(err).WithFields(sess.logFields()).Fatal("Unable to load filter configuration")
 	}
-	sess.Server = server
-	sess.StartTime = time.Now().UTC()
+	sess.Filters = filters
 
 	return sess
 }
@@ -309,23 +594,30 @@ func NewReplaySession() (sess ReplaySession) {
 func (s *ReplaySession) ReadPacketsFromFile(filename string) {
 	file, err := os.Open(filename)
 	if err != nil {
-		log.Fatalf("Unable to open recorded packets file: %v\n", err)
+		logger.WithError(err).WithFields(s.logFields()).Fatal("Unable to open recorded packets file")
 	}
 	defer file.Close()
 
 	data, err := ioutil.ReadAll(file)
 	if err != nil {
-		log.Fatalf("Unable to read recorded packets file: %v\n", err)
+		logger.WithError(err).WithFields(s.logFields()).Fatal("Unable to read recorded packets file")
 	}
 
 	if err := json.Unmarshal(data, &s.SerializableSession); err != nil {
-		log.Fatalf("Unable to unmarshal recorded packets from file: %v\n", err)
+		logger.WithError(err).WithFields(s.logFields()).Fatal("Unable to unmarshal recorded packets from file")
 	}
 }
 
-func (s *ReplaySession) respondToServer() {
+// respondToServer answers keepalives and teleport confirms as soon as they
+// arrive in real wall-clock time, independent of -speed, so slowing down
+// replayPackets doesn't get us kicked for lag. It reads and writes conn
+// directly, rather than s.Server, so a stale goroutine from a connection
+// that replayPackets has already redialed past can't race with the new one:
+// it keeps talking to the (now closed) connection it was handed and exits
+// cleanly once that connection's ReadPacket errors out.
+func (s *ReplaySession) respondToServer(conn *mcNet.Conn) {
 	for {
-		packet, err := s.Server.ReadPacket()
+		packet, err := conn.ReadPacket()
 		if err != nil {
 			break
 		}
@@ -338,10 +630,13 @@ func (s *ReplaySession) respondToServer() {
 				}
 
 				response := mcPkt.Marshal(0x10, keepID)
-				if err := s.Server.WritePacket(response); err != nil {
+				if err := conn.WritePacket(response); err != nil {
 					continue
 				}
-				log.Printf("Responded to keepAlive\n")
+				logger.WithFields(s.logFields()).WithFields(logrus.Fields{
+					"direction": directionName(pcap.Serverbound),
+					"packet_id": packetIDHex(response.ID),
+				}).Debug("Responded to keepAlive")
 			}
 
 			if packet.ID == 0x34 {
@@ -354,10 +649,13 @@ func (s *ReplaySession) respondToServer() {
 				}
 
 				response := mcPkt.Marshal(0x00, tpID)
-				if err := s.Server.WritePacket(response); err != nil {
+				if err := conn.WritePacket(response); err != nil {
 					continue
 				}
-				log.Printf("Responded with teleport confirm\n")
+				logger.WithFields(s.logFields()).WithFields(logrus.Fields{
+					"direction": directionName(pcap.Serverbound),
+					"packet_id": packetIDHex(response.ID),
+				}).Debug("Responded with teleport confirm")
 			}
 		}
 
@@ -365,28 +663,148 @@ func (s *ReplaySession) respondToServer() {
 	}
 }
 
-func (s *ReplaySession) replayPackets() {
-	for _, packet := range s.Packets {
+// loginPrefix returns the serverbound Handshake/Login packets recorded
+// before the session reached the play state, in order. A fresh connection
+// needs these to reach the play state at all, so they always run in full on
+// every redialed connection, regardless of -start-at/-stop-at.
+func (s *ReplaySession) loginPrefix() []recordedPacket {
+	var prefix []recordedPacket
+	for _, p := range s.Packets {
+		if p.Direction != pcap.Serverbound || p.State == play {
+			continue
+		}
+		prefix = append(prefix, p)
+	}
+	return prefix
+}
+
+// selectPlayPackets returns the serverbound play-state packets that fall
+// within [-start-at, -stop-at), in recording order. A zero -stop-at means no
+// upper bound.
+func (s *ReplaySession) selectPlayPackets() []recordedPacket {
+	var selected []recordedPacket
+	for _, p := range s.Packets {
+		if p.Direction != pcap.Serverbound || p.State != play {
+			continue
+		}
+		if p.RelatTime < *replayStartAt {
+			continue
+		}
+		if *replayStopAt > 0 && p.RelatTime >= *replayStopAt {
+			continue
+		}
+		selected = append(selected, p)
+	}
+	return selected
+}
+
+// scaledRelatTime applies -speed and -start-at to a packet's recorded
+// relative time, so replaying at 2x finishes in half the wall-clock time and
+// replaying at 0.5x takes twice as long.
+func scaledRelatTime(relatTime time.Duration) time.Duration {
+	speed := *replaySpeed
+	if speed <= 0 {
+		speed = 1
+	}
+	return time.Duration(float64(relatTime-*replayStartAt) / speed)
+}
+
+func jitterDelay() time.Duration {
+	if *replayJitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(*replayJitter)))
+}
+
+// sendSequence replays packets in order against s.Server, applying filters
+// and pacing each packet by its recorded relative time, shifted by -start-at,
+// scaled by -speed and delayed by up to -jitter. indexOffset is added to
+// each packet's position for the "replay_index" log field, so the prefix and
+// the play-state slice sent after it log a single, stable index across the
+// whole recorded stream. It returns false if a WritePacket call fails, so the
+// caller can stop the rest of the iteration.
+func (s *ReplaySession) sendSequence(packets []recordedPacket, iteration, indexOffset int) bool {
+	for i, packet := range packets {
 		if s.State == play {
 			if !s.wasPorted && packet.Packet.ID >= 0x12 && packet.Packet.ID <= 0x16 {
 				s.portToLogin()
 			}
 		}
 
-		waitTime := packet.RelatTime - time.Since(s.StartTime)
+		outgoing, keep := s.Filters.Apply(packet.Direction, s.State, packet.Packet)
+		if !keep {
+			logger.WithFields(s.logFields()).WithFields(logrus.Fields{
+				"direction":    directionName(packet.Direction),
+				"packet_id":    packetIDHex(packet.Packet.ID),
+				"replay_index": indexOffset + i,
+			}).Debug("Dropped packet by filter")
+			continue
+		}
+
+		waitTime := scaledRelatTime(packet.RelatTime) + jitterDelay() - time.Since(s.StartTime)
 		if waitTime > 0 {
 			time.Sleep(waitTime)
 		}
 
-		s.setStateFromServerbound(packet.Packet.ID)
-		log.Printf("Sending packet: %v\n", packet)
-		if err := s.Server.WritePacket(packet.Packet); err != nil {
-			break
+		s.setStateFromServerbound(outgoing.ID)
+		logger.WithFields(s.logFields()).WithFields(logrus.Fields{
+			"direction":     directionName(packet.Direction),
+			"packet_id":     packetIDHex(outgoing.ID),
+			"replay_index":  indexOffset + i,
+			"relative_time": packet.RelatTime,
+			"iteration":     iteration,
+		}).Debug("Sending packet")
+		if err := s.Server.WritePacket(outgoing); err != nil {
+			logger.WithError(err).WithFields(s.logFields()).Error("Unable to send packet to server")
+			return false
 		}
 	}
 
-	if err := s.Server.Close(); err != nil {
-		log.Fatalf("Unable to close connection to server")
+	return true
+}
+
+// waitForPlayState blocks until respondToServer, reading clientbound packets
+// on its own goroutine, has observed Login Success and flipped s.State to
+// play. There's no channel/mutex signaling between the two goroutines here,
+// matching the rest of the session's existing tolerance for unsynchronized
+// access to s.State, so this just polls.
+func (s *ReplaySession) waitForPlayState() {
+	for s.State != play {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (s *ReplaySession) replayPackets() {
+	prefix := s.loginPrefix()
+	playPackets := s.selectPlayPackets()
+
+	loops := *replayLoop
+	if loops < 1 {
+		loops = 1
+	}
+
+	for iteration := 1; iteration <= loops; iteration++ {
+		backendConn, err := mcNet.DialMC(*goalAddress)
+		if err != nil {
+			logger.WithError(err).WithFields(s.logFields()).Fatal("Unable to connect to backend")
+		}
+		s.Server = backendConn
+		s.State = handshaking
+		s.wasPorted = false
+		s.StartTime = time.Now().UTC()
+
+		go s.respondToServer(backendConn)
+
+		if s.sendSequence(prefix, iteration, 0) {
+			s.waitForPlayState()
+			s.sendSequence(playPackets, iteration, len(prefix))
+		}
+
+		logger.WithFields(s.logFields()).WithField("iteration", iteration).Info("Finished replay iteration")
+
+		if err := s.Server.Close(); err != nil {
+			logger.WithError(err).WithFields(s.logFields()).Error("Unable to close connection to server")
+		}
 	}
 }
 
@@ -394,7 +812,7 @@ func (s *ReplaySession) portToLogin() {
 	var message = mcPkt.String(fmt.Sprintf("/teleport %f %f %f", s.LoginX, s.LoginY, s.LoginZ))
 	packet := mcPkt.Marshal(0x03, message)
 	if err := s.Server.WritePacket(packet); err != nil {
-		log.Printf("Unable to send teleport packet to server: %v\n", err)
+		logger.WithError(err).WithFields(s.logFields()).Error("Unable to send teleport packet to server")
 		return
 	}
 